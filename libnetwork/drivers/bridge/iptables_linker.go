@@ -0,0 +1,60 @@
+//go:build linux
+
+package bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/libnetwork/iptables"
+	"github.com/docker/docker/libnetwork/types"
+)
+
+// iptablesLinker is the historical Linker backend, programming link rules
+// via the legacy iptables package.
+type iptablesLinker struct{}
+
+func (iptablesLinker) Link(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error {
+	return linkContainers("-A", parentIP.String(), childIP.String(), ports, bridge, false)
+}
+
+func (iptablesLinker) Unlink(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error {
+	return linkContainers("-D", parentIP.String(), childIP.String(), ports, bridge, true)
+}
+
+func (iptablesLinker) OnReloaded(fn func()) {
+	iptables.OnReloaded(fn)
+}
+
+func linkContainers(action, parentIP, childIP string, ports []types.TransportPort, bridge string, ignoreErrors bool) error {
+	var nfAction iptables.Action
+
+	switch action {
+	case "-A":
+		nfAction = iptables.Append
+	case "-I":
+		nfAction = iptables.Insert
+	case "-D":
+		nfAction = iptables.Delete
+	default:
+		return fmt.Errorf("invalid iptables action: %s", action)
+	}
+
+	ip1 := net.ParseIP(parentIP)
+	if ip1 == nil {
+		return fmt.Errorf("cannot link to a container with an invalid parent IP address %q", parentIP)
+	}
+	ip2 := net.ParseIP(childIP)
+	if ip2 == nil {
+		return fmt.Errorf("cannot link to a container with an invalid child IP address %q", childIP)
+	}
+
+	chain := iptables.ChainInfo{Name: DockerChain}
+	for _, port := range ports {
+		err := chain.Link(nfAction, ip1, ip2, int(port.Port), port.Proto.String(), bridge)
+		if !ignoreErrors && err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"net"
 
 	"github.com/containerd/containerd/log"
-	"github.com/docker/docker/libnetwork/iptables"
 	"github.com/docker/docker/libnetwork/types"
 )
 
@@ -17,6 +16,7 @@ type link struct {
 	childIP  string
 	ports    []types.TransportPort
 	bridge   string
+	linker   Linker
 }
 
 func (l *link) String() string {
@@ -29,58 +29,40 @@ func newLink(parentIP, childIP string, ports []types.TransportPort, bridge strin
 		parentIP: parentIP,
 		ports:    ports,
 		bridge:   bridge,
+		linker:   selectLinker(),
 	}
 }
 
 func (l *link) Enable() error {
-	// -A == iptables append flag
+	parentIP := net.ParseIP(l.parentIP)
+	if parentIP == nil {
+		return fmt.Errorf("cannot link to a container with an invalid parent IP address %q", l.parentIP)
+	}
+	childIP := net.ParseIP(l.childIP)
+	if childIP == nil {
+		return fmt.Errorf("cannot link to a container with an invalid child IP address %q", l.childIP)
+	}
+
 	linkFunction := func() error {
-		return linkContainers("-A", l.parentIP, l.childIP, l.ports, l.bridge, false)
+		return l.linker.Link(parentIP, childIP, l.ports, l.bridge)
 	}
 
-	iptables.OnReloaded(func() { linkFunction() })
+	l.linker.OnReloaded(func() { linkFunction() })
 	return linkFunction()
 }
 
 func (l *link) Disable() {
-	// -D == iptables delete flag
-	err := linkContainers("-D", l.parentIP, l.childIP, l.ports, l.bridge, true)
+	parentIP := net.ParseIP(l.parentIP)
+	childIP := net.ParseIP(l.childIP)
+	if parentIP == nil || childIP == nil {
+		log.G(context.TODO()).Errorf("Error removing rules for a link %s due to invalid IP address", l.String())
+		return
+	}
+
+	err := l.linker.Unlink(parentIP, childIP, l.ports, l.bridge)
 	if err != nil {
-		log.G(context.TODO()).Errorf("Error removing IPTables rules for a link %s due to %s", l.String(), err.Error())
+		log.G(context.TODO()).Errorf("Error removing rules for a link %s due to %s", l.String(), err.Error())
 	}
 	// Return proper error once we move to use a proper iptables package
 	// that returns typed errors
 }
-
-func linkContainers(action, parentIP, childIP string, ports []types.TransportPort, bridge string, ignoreErrors bool) error {
-	var nfAction iptables.Action
-
-	switch action {
-	case "-A":
-		nfAction = iptables.Append
-	case "-I":
-		nfAction = iptables.Insert
-	case "-D":
-		nfAction = iptables.Delete
-	default:
-		return fmt.Errorf("invalid iptables action: %s", action)
-	}
-
-	ip1 := net.ParseIP(parentIP)
-	if ip1 == nil {
-		return fmt.Errorf("cannot link to a container with an invalid parent IP address %q", parentIP)
-	}
-	ip2 := net.ParseIP(childIP)
-	if ip2 == nil {
-		return fmt.Errorf("cannot link to a container with an invalid child IP address %q", childIP)
-	}
-
-	chain := iptables.ChainInfo{Name: DockerChain}
-	for _, port := range ports {
-		err := chain.Link(nfAction, ip1, ip2, int(port.Port), port.Proto.String(), bridge)
-		if !ignoreErrors && err != nil {
-			return err
-		}
-	}
-	return nil
-}
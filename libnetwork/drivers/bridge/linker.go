@@ -0,0 +1,93 @@
+//go:build linux
+
+package bridge
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/log"
+	"github.com/docker/docker/libnetwork/types"
+)
+
+// Linker programs the firewall rules backing a container link: the
+// parent/child IP pair, port list and bridge name they apply to. Two
+// implementations exist, one for iptables and one for nftables; link.Enable
+// and link.Disable are backend-agnostic and only talk to this interface.
+type Linker interface {
+	// Link installs rules allowing parentIP to reach childIP on ports via
+	// bridge.
+	Link(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error
+	// Unlink removes the rules previously installed by Link. A failure on
+	// one port does not stop the remaining ports and is not returned
+	// (nftablesLinker logs it, iptablesLinker drops it), matching
+	// link.Disable's historical best-effort cleanup behavior.
+	Unlink(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error
+	// OnReloaded registers fn to be re-run after this backend's ruleset is
+	// flushed and reloaded, so link rules survive e.g. a `systemctl reload
+	// nftables` or `iptables-restore`.
+	OnReloaded(fn func())
+}
+
+// LinkerBackend selects which firewall tooling newLink's Linker is backed
+// by.
+type LinkerBackend int
+
+const (
+	// LinkerBackendAuto picks iptables or nftables based on whether the
+	// system's iptables binary is itself operating in nf_tables
+	// compatibility mode.
+	LinkerBackendAuto LinkerBackend = iota
+	LinkerBackendIPTables
+	LinkerBackendNFTables
+)
+
+var (
+	linkerMu      sync.Mutex
+	linkerBackend = LinkerBackendAuto
+)
+
+// SetLinkerBackend sets the daemon-configured firewall backend used for
+// container links. It must be called, if at all, before any network with
+// links is created; newLink reads the selection each time it builds a
+// link.
+func SetLinkerBackend(backend LinkerBackend) {
+	linkerMu.Lock()
+	defer linkerMu.Unlock()
+	linkerBackend = backend
+}
+
+func selectLinker() Linker {
+	linkerMu.Lock()
+	backend := linkerBackend
+	linkerMu.Unlock()
+
+	switch backend {
+	case LinkerBackendNFTables:
+		return &nftablesLinker{}
+	case LinkerBackendIPTables:
+		return &iptablesLinker{}
+	default:
+		if iptablesInNFTCompatMode() {
+			return &nftablesLinker{}
+		}
+		return &iptablesLinker{}
+	}
+}
+
+// iptablesInNFTCompatMode reports whether the system's `iptables` binary is
+// itself a shim translating to the nf_tables backend (as shipped by
+// default on current Debian/Fedora derivatives), in which case link rules
+// should be programmed directly via nftables to avoid being invisible to
+// `nft list ruleset`.
+func iptablesInNFTCompatMode() bool {
+	out, err := exec.Command("iptables", "-V").CombinedOutput()
+	if err != nil {
+		log.G(context.TODO()).WithError(err).Debug("bridge: failed to detect iptables backend, defaulting to legacy iptables")
+		return false
+	}
+	return strings.Contains(string(out), "(nf_tables)")
+}
@@ -0,0 +1,312 @@
+//go:build linux
+
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/log"
+	"github.com/docker/docker/libnetwork/types"
+)
+
+// nftFamily/nftTable/nftChain name the table/chain link rules are
+// programmed into, mirroring DockerChain's role for the iptables backend.
+// Unlike iptables chains, an nftables base chain must be created (with its
+// hook) before rules can be added to it.
+const (
+	nftFamily = "inet"
+	nftTable  = "docker"
+	nftChain  = "DOCKER"
+)
+
+// nftablesLinker is a Linker backend that programs link rules via the
+// `nft` binary instead of going through iptables. It produces rules that
+// are semantically equivalent to iptablesLinker's for the same
+// parent/child/port tuple, but are visible to, and survive reloads of, a
+// native nftables ruleset.
+type nftablesLinker struct{}
+
+func (nftablesLinker) Link(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error {
+	if err := nftEnsureChain(); err != nil {
+		return err
+	}
+
+	for _, port := range ports {
+		spec := nftRuleSpec{port: int(port.Port), proto: port.Proto.String()}
+		handle, err := nftAddRule(parentIP, childIP, bridge, spec)
+		if err != nil {
+			return err
+		}
+		nftHandles.set(nftHandleKey(parentIP, childIP, bridge, spec), handle)
+	}
+	return nil
+}
+
+// Unlink removes the rules previously installed by Link. Like
+// iptablesLinker.Unlink, it tries every port and ignores individual
+// failures rather than aborting partway through.
+//
+// nftHandles is only an in-memory cache of the handle Link got back when it
+// added the rule: it does not survive a daemon restart, yet nftables rules
+// are only removable by handle (see nftAddRule). So when a key isn't found
+// there, fall back to nftFindRuleHandle, which reconstructs the handle by
+// listing the chain and matching the rule by its parent/child/port tuple.
+func (nftablesLinker) Unlink(parentIP, childIP net.IP, ports []types.TransportPort, bridge string) error {
+	for _, port := range ports {
+		spec := nftRuleSpec{port: int(port.Port), proto: port.Proto.String()}
+		key := nftHandleKey(parentIP, childIP, bridge, spec)
+
+		handle, ok := nftHandles.pop(key)
+		if !ok {
+			var err error
+			handle, ok, err = nftFindRuleHandle(parentIP, childIP, bridge, spec)
+			if err != nil {
+				log.G(context.TODO()).WithError(err).Warnf("bridge: failed to look up nftables link rule for %s<->%s", parentIP, childIP)
+				continue
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := nftDeleteRule(handle); err != nil {
+			log.G(context.TODO()).WithError(err).Warnf("bridge: failed to remove nftables link rule for %s<->%s", parentIP, childIP)
+		}
+	}
+	return nil
+}
+
+func (nftablesLinker) OnReloaded(fn func()) {
+	nftOnReloaded(fn)
+}
+
+// nftRuleSpec is the per-port record the nftables renderer consumes. Its
+// fields are the same port/proto pair iptablesLinker passes to chain.Link,
+// letting tests assert the two backends agree on semantics without
+// comparing their differing rule syntaxes directly.
+type nftRuleSpec struct {
+	port  int
+	proto string
+}
+
+func nftRuleArgs(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) []string {
+	return append([]string{nftFamily, nftTable, nftChain}, nftRuleMatchTokens(parentIP, childIP, bridge, spec)...)
+}
+
+// nftRuleMatchTokens is the match/verdict portion of a link rule, shared by
+// nftRuleArgs (to build the `nft add rule` command) and nftFindRuleHandle
+// (to recognize the same rule in `nft list chain` output, which omits the
+// leading family/table/chain that nftRuleArgs needs for add).
+func nftRuleMatchTokens(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) []string {
+	return []string{
+		"ip", "saddr", parentIP.String(),
+		"ip", "daddr", childIP.String(),
+		"iifname", bridge, "oifname", bridge,
+		spec.proto, "dport", strconv.Itoa(spec.port),
+		"counter", "accept",
+	}
+}
+
+// nftEnsureChain creates the docker table/base chain if they do not
+// already exist. `nft add table`/`nft add chain` are no-ops when the
+// object already exists, so this is safe to call before every Link.
+func nftEnsureChain() error {
+	if err := nftExec("add", "table", nftFamily, nftTable); err != nil {
+		return err
+	}
+	return nftExec("add", "chain", nftFamily, nftTable, nftChain,
+		"{", "type", "filter", "hook", "forward", "priority", "0", ";", "}")
+}
+
+// nftAddRuleCmdArgs builds the `nft` argument list for adding a link rule.
+// -e (--echo) is required for nft to print the rule it just added at all;
+// -a alone only annotates handles in `list` output, not `add` output.
+func nftAddRuleCmdArgs(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) []string {
+	return append([]string{"-e", "-a", "add", "rule"}, nftRuleArgs(parentIP, childIP, bridge, spec)...)
+}
+
+// nftAddRule adds a rule and returns the handle nftables assigned it, so
+// that Unlink can later remove exactly that rule with
+// `nft delete rule ... handle <n>` — nftables has no equivalent of
+// iptables' "delete by re-specifying the match", rules are only
+// addressable by handle.
+func nftAddRule(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) (int, error) {
+	args := nftAddRuleCmdArgs(parentIP, childIP, bridge, spec)
+	out, err := exec.Command("nft", args...).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("nft %v: %w: %s", args, err, out)
+	}
+	return parseNftHandle(string(out))
+}
+
+func nftDeleteRule(handle int) error {
+	return nftExec("delete", "rule", nftFamily, nftTable, nftChain, "handle", strconv.Itoa(handle))
+}
+
+// nftFindRuleHandle reconstructs the handle for the rule matching
+// parentIP/childIP/bridge/spec by listing the chain (with handles
+// annotated via -a) and matching each line against the rule's match
+// tokens, for when nftHandles has no entry for it (e.g. the rule was
+// programmed by an earlier daemon process before a restart). ok is false,
+// with a nil error, if no rule in the chain matches.
+func nftFindRuleHandle(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) (handle int, ok bool, err error) {
+	out, err := exec.Command("nft", "-a", "list", "chain", nftFamily, nftTable, nftChain).CombinedOutput()
+	if err != nil {
+		return 0, false, fmt.Errorf("nft -a list chain: %w: %s", err, out)
+	}
+
+	want := nftRuleMatchTokens(parentIP, childIP, bridge, spec)
+	for _, line := range strings.Split(string(out), "\n") {
+		if !nftLineMatchesAllTokens(line, want) {
+			continue
+		}
+		h, err := parseNftHandle(line)
+		if err != nil {
+			continue
+		}
+		return h, true, nil
+	}
+	return 0, false, nil
+}
+
+// nftLineMatchesAllTokens reports whether every token in want appears, in
+// order, as a whole (unquoted) field of line. nft's list output reformats a
+// rule (quoting, normalizing counter stats, etc.) so an exact string match
+// against what was used to add the rule is not reliable; requiring every
+// match token to appear as its own field, in the same order, is enough to
+// identify it unambiguously within a single chain.
+func nftLineMatchesAllTokens(line string, want []string) bool {
+	i := 0
+	for _, field := range strings.Fields(line) {
+		if i < len(want) && strings.Trim(field, `"`) == want[i] {
+			i++
+		}
+	}
+	return i == len(want)
+}
+
+func nftExec(args ...string) error {
+	out, err := exec.Command("nft", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft %v: %w: %s", args, err, out)
+	}
+	return nil
+}
+
+// parseNftHandle extracts the rule handle nft printed (via -a) in a line
+// of the form "... # handle 5".
+func parseNftHandle(out string) (int, error) {
+	idx := strings.LastIndex(out, "# handle ")
+	if idx < 0 {
+		return 0, fmt.Errorf("nft: could not find rule handle in output: %q", out)
+	}
+	var handle int
+	if _, err := fmt.Sscanf(out[idx:], "# handle %d", &handle); err != nil {
+		return 0, fmt.Errorf("nft: invalid handle in output %q: %w", out, err)
+	}
+	return handle, nil
+}
+
+// nftLinkKey identifies one programmed link rule so that Unlink can look
+// up the handle Link got back for it.
+type nftLinkKey struct {
+	parent, child, bridge, proto string
+	port                         int
+}
+
+func nftHandleKey(parentIP, childIP net.IP, bridge string, spec nftRuleSpec) nftLinkKey {
+	return nftLinkKey{parent: parentIP.String(), child: childIP.String(), bridge: bridge, proto: spec.proto, port: spec.port}
+}
+
+var nftHandles = nftHandleStore{handles: make(map[nftLinkKey]int)}
+
+type nftHandleStore struct {
+	mu      sync.Mutex
+	handles map[nftLinkKey]int
+}
+
+func (s *nftHandleStore) set(key nftLinkKey, handle int) {
+	s.mu.Lock()
+	s.handles[key] = handle
+	s.mu.Unlock()
+}
+
+func (s *nftHandleStore) get(key nftLinkKey) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handle, ok := s.handles[key]
+	return handle, ok
+}
+
+func (s *nftHandleStore) pop(key nftLinkKey) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handle, ok := s.handles[key]
+	if ok {
+		delete(s.handles, key)
+	}
+	return handle, ok
+}
+
+var (
+	nftReloadMu   sync.Mutex
+	nftReloadFns  []func()
+	nftWatchStart sync.Once
+)
+
+// nftOnReloaded registers fn to run whenever the nftables ruleset has been
+// flushed and needs its link rules reprogrammed, the nftables-backend
+// analogue of iptables.OnReloaded. The first registration starts a
+// background `nft monitor` watcher that detects such flushes.
+func nftOnReloaded(fn func()) {
+	nftReloadMu.Lock()
+	nftReloadFns = append(nftReloadFns, fn)
+	nftReloadMu.Unlock()
+
+	nftWatchStart.Do(startNftReloadWatcher)
+}
+
+// nftFireReloaded runs every callback registered via nftOnReloaded.
+func nftFireReloaded() {
+	nftReloadMu.Lock()
+	fns := append([]func(){}, nftReloadFns...)
+	nftReloadMu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// startNftReloadWatcher runs `nft monitor` for the lifetime of the daemon
+// and fires the registered reload callbacks whenever the docker table is
+// flushed or recreated out from under us (e.g. by `nft flush ruleset` or a
+// firewall reload tool), mirroring how the iptables backend is notified of
+// an external `iptables-restore`.
+func startNftReloadWatcher() {
+	cmd := exec.Command("nft", "monitor", "table")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.G(context.TODO()).WithError(err).Warn("bridge: failed to watch nftables for ruleset flushes, link rules will not survive one")
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.G(context.TODO()).WithError(err).Warn("bridge: failed to start nft monitor, link rules will not survive a ruleset flush")
+		return
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			f := strings.Fields(scanner.Text())
+			if len(f) >= 4 && (f[0] == "flush" || f[0] == "delete") && f[1] == "table" && f[2] == nftFamily && f[3] == nftTable {
+				nftFireReloaded()
+			}
+		}
+	}()
+}
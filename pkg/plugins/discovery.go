@@ -0,0 +1,121 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/pkg/errors"
+)
+
+// LocalRegistry discovers v1 plugins from the JSON spec files under
+// specsPaths. socketsPath is recorded but never read: a plugin that exists
+// only as a socket there is not discovered.
+type LocalRegistry struct {
+	socketsPath string
+	specsPaths  []string
+}
+
+// registrySpec is the on-disk JSON format of a plugin spec file.
+type registrySpec struct {
+	Name      string
+	Addr      string
+	TLSConfig *tlsconfig.Options
+}
+
+// Plugin returns the plugin registered under name, loading its spec from
+// disk and registering it in storage the first time it is requested.
+func (r *LocalRegistry) Plugin(name string) (*Plugin, error) {
+	storage.Lock()
+	if p, ok := storage.plugins[name]; ok {
+		storage.Unlock()
+		return p, nil
+	}
+	storage.Unlock()
+
+	spec, err := r.readSpec(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{
+		name:         name,
+		Addr:         spec.Addr,
+		TLSConfig:    spec.TLSConfig,
+		activateWait: sync.NewCond(&sync.Mutex{}),
+	}
+
+	storage.Lock()
+	storage.plugins[name] = p
+	storage.Unlock()
+
+	return p, nil
+}
+
+func (r *LocalRegistry) readSpec(name string) (*registrySpec, error) {
+	for _, dir := range r.specsPaths {
+		b, err := os.ReadFile(filepath.Join(dir, name+".json"))
+		if err != nil {
+			continue
+		}
+		var spec registrySpec
+		if err := json.Unmarshal(b, &spec); err != nil {
+			return nil, errors.Wrapf(err, "plugin %q: invalid spec", name)
+		}
+		return &spec, nil
+	}
+	return nil, errors.Wrapf(ErrNotFound, "plugin %q", name)
+}
+
+// scan lists the plugin names discoverable from specsPaths, without
+// loading or activating them.
+func (r *LocalRegistry) scan() []string {
+	var names []string
+	for _, dir := range r.specsPaths {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	return names
+}
+
+// GetAll returns every discovered plugin implementing implements,
+// activating each one as needed and filtering out any whose manifest gates
+// implements behind SetExperimental while the daemon is not running with
+// experimental features enabled.
+func (r *LocalRegistry) GetAll(implements string) ([]*Plugin, error) {
+	var result []*Plugin
+	for _, name := range r.scan() {
+		p, err := r.Plugin(name)
+		if err != nil {
+			continue
+		}
+
+		if p.Manifest == nil {
+			if err := p.activate(); err != nil {
+				continue
+			}
+		}
+
+		if !p.implements(implements) {
+			continue
+		}
+
+		if checkExperimental(p.Manifest, implements) != nil {
+			continue
+		}
+
+		result = append(result, p)
+	}
+	return result, nil
+}
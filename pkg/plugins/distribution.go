@@ -0,0 +1,201 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDigestMismatch is returned when the bytes fetched for a plugin blob do
+// not hash to the digest that was requested or pinned via an Alias.
+var ErrDigestMismatch = errors.New("plugin: content digest mismatch")
+
+// blobAlgorithm is the only digest algorithm DigestRegistry currently
+// understands. It is kept as a constant rather than parsed out of the
+// reference so that malformed references fail fast instead of silently
+// skipping verification.
+const blobAlgorithm = "sha256"
+
+// BlobFetcher retrieves the raw manifest/config bytes for a digest-pinned
+// plugin reference from wherever a DigestRegistry's blobs are hosted (e.g.
+// an OCI-compatible registry's blob endpoint). DigestRegistry verifies
+// whatever bytes it returns against digest before trusting them, so a
+// Fetcher does not need to authenticate the transport, only locate the
+// blob.
+type BlobFetcher func(name, digest string) ([]byte, error)
+
+// DigestRegistry resolves v1 plugin specs by content digest and persists
+// the pulled manifest/config blobs in a local, content-addressable store.
+// It mirrors the verification model used for v2 managed plugins, but keeps
+// the legacy v1 HTTP activation path: once a blob has been verified it is
+// registered in storage.plugins exactly like a LocalRegistry plugin.
+type DigestRegistry struct {
+	mu sync.Mutex
+
+	// blobStorePath is a directory where pulled manifest/config bytes are
+	// kept, named by their hex digest (e.g. "<blobStorePath>/<sha256 hex>").
+	blobStorePath string
+
+	// alias maps a short, human-friendly name (e.g. "fruit") to a pinned
+	// reference of the form "<name>@sha256:<digest>". Resolving through an
+	// alias guarantees the same reproducible bytes are activated every time.
+	// It is unexported because reads (resolveAlias, via Get) and writes
+	// (SetAlias) share r.mu; a caller mutating the map directly would race
+	// with a concurrent Get.
+	alias map[string]string
+
+	// Fetch retrieves a blob that isn't already present in the local
+	// blobstore. It is nil by default, meaning only blobs that were
+	// previously pulled via Pull (or a prior Fetch) can be activated; set
+	// it to pull from a remote registry on demand.
+	Fetch BlobFetcher
+}
+
+// NewDigestRegistry creates a DigestRegistry that stores pulled blobs under
+// blobStorePath, creating it if it does not already exist.
+func NewDigestRegistry(blobStorePath string, alias map[string]string) (*DigestRegistry, error) {
+	if err := os.MkdirAll(blobStorePath, 0o700); err != nil {
+		return nil, errors.Wrap(err, "plugins: failed to create blobstore")
+	}
+	if alias == nil {
+		alias = make(map[string]string)
+	}
+	return &DigestRegistry{
+		blobStorePath: blobStorePath,
+		alias:         alias,
+	}, nil
+}
+
+// SetAlias registers name as an alias for the pinned reference ref (e.g.
+// "fruit@sha256:..."), so that a subsequent Get(name) resolves to ref. It
+// is safe to call concurrently with Get.
+func (r *DigestRegistry) SetAlias(name, ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alias[name] = ref
+}
+
+// Get resolves ref, which must be either an alias registered via SetAlias or
+// a digest-pinned reference ("fruit@sha256:..."), verifies the blob bytes
+// against the pinned digest, and registers the resulting Plugin in the
+// global plugin storage so it can subsequently be found through the
+// regular Get/Handle path. A bare, unpinned name (no digest, no alias) is
+// always rejected: DigestRegistry's guarantee is that the activated bytes
+// match a known digest, which a bare name cannot express. Use LocalRegistry
+// for unpinned, spec-file-based lookups instead.
+//
+// If the blob is not already present in the local blobstore, Get pulls it
+// via r.Fetch (when configured) and persists it exactly as Pull would, then
+// verifies it against the pinned digest like a local blob.
+func (r *DigestRegistry) Get(ref string) (*Plugin, error) {
+	name, digest, err := splitDigestRef(r.resolveAlias(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := r.fetchBlob(name, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if digest != "" {
+		if sum := sha256sum(blob); sum != digest {
+			return nil, errors.Wrapf(ErrDigestMismatch, "plugin %q: expected %s:%s, got %s:%s", name, blobAlgorithm, digest, blobAlgorithm, sum)
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(blob, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "plugin %q: invalid manifest", name)
+	}
+
+	p := &Plugin{
+		name:         name,
+		Manifest:     &manifest,
+		activateWait: sync.NewCond(&sync.Mutex{}),
+	}
+
+	storage.Lock()
+	storage.plugins[name] = p
+	storage.Unlock()
+
+	return p, nil
+}
+
+// resolveAlias returns the pinned reference for ref if one is registered via
+// SetAlias, otherwise it returns ref unchanged.
+func (r *DigestRegistry) resolveAlias(ref string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pinned, ok := r.alias[ref]; ok {
+		return pinned
+	}
+	return ref
+}
+
+// fetchBlob returns the manifest/config bytes for name, preferring a local
+// copy in the blobstore, and falling back to r.Fetch (if configured) to
+// pull and persist it otherwise. It does not verify the bytes; Get does.
+func (r *DigestRegistry) fetchBlob(name, digest string) ([]byte, error) {
+	if digest == "" {
+		return nil, errors.Errorf("plugin %q: DigestRegistry requires a digest-pinned reference (e.g. %q)", name, name+"@sha256:<digest>")
+	}
+
+	if b, err := os.ReadFile(r.blobPath(digest)); err == nil {
+		return b, nil
+	}
+
+	if r.Fetch == nil {
+		return nil, errors.Errorf("plugin %q: blob %s:%s not found locally and no Fetch is configured", name, blobAlgorithm, digest)
+	}
+
+	blob, err := r.Fetch(name, digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "plugin %q: failed to fetch blob %s:%s", name, blobAlgorithm, digest)
+	}
+	if _, err := r.Pull(name, blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// Pull stores blob in the local blobstore, keyed by its sha256 digest, and
+// returns the digest so that callers can build a pinned reference such as
+// "<name>@sha256:<digest>".
+func (r *DigestRegistry) Pull(name string, blob []byte) (string, error) {
+	digest := sha256sum(blob)
+	if err := os.WriteFile(r.blobPath(digest), blob, 0o600); err != nil {
+		return "", errors.Wrapf(err, "plugin %q: failed to persist blob", name)
+	}
+	return digest, nil
+}
+
+func (r *DigestRegistry) blobPath(digest string) string {
+	return filepath.Join(r.blobStorePath, digest)
+}
+
+// splitDigestRef splits a reference of the form "name" or
+// "name@sha256:digest" into its name and (possibly empty) digest.
+func splitDigestRef(ref string) (name, digest string, err error) {
+	name, rest, ok := strings.Cut(ref, "@")
+	if !ok {
+		return ref, "", nil
+	}
+	algo, digest, ok := strings.Cut(rest, ":")
+	if !ok || algo != blobAlgorithm {
+		return "", "", fmt.Errorf("plugin %q: unsupported digest reference %q", name, rest)
+	}
+	return name, digest, nil
+}
+
+func sha256sum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,149 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gotest.tools/v3/assert"
+)
+
+func TestDigestRegistryGet(t *testing.T) {
+	tmpdir := t.TempDir()
+	r, err := NewDigestRegistry(tmpdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := json.Marshal(Manifest{Implements: []string{fruitImplements}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := r.Pull(fruitPlugin, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin, err := r.Get(fruitPlugin + "@sha256:" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin.Name() != fruitPlugin {
+		t.Fatalf("expected plugin named %s, got %s", fruitPlugin, plugin.Name())
+	}
+}
+
+func TestDigestRegistryGetAlias(t *testing.T) {
+	tmpdir := t.TempDir()
+	r, err := NewDigestRegistry(tmpdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := json.Marshal(Manifest{Implements: []string{fruitImplements}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := r.Pull(fruitPlugin, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetAlias("fruit-stable", fruitPlugin+"@sha256:"+digest)
+
+	plugin, err := r.Get("fruit-stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin.Name() != fruitPlugin {
+		t.Fatalf("expected plugin named %s, got %s", fruitPlugin, plugin.Name())
+	}
+}
+
+// TestDigestRegistryTamperedBlob asserts that activation refuses to
+// register a plugin whose on-disk blob bytes no longer match the digest
+// it was pulled and pinned at.
+func TestDigestRegistryTamperedBlob(t *testing.T) {
+	tmpdir := t.TempDir()
+	r, err := NewDigestRegistry(tmpdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := json.Marshal(Manifest{Implements: []string{fruitImplements}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := r.Pull(fruitPlugin, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tamper with the blob after it has been pulled and pinned, simulating
+	// an on-disk modification or a compromised mirror.
+	tampered := append(blob, []byte(`"tampered"`)...)
+	if err := os.WriteFile(r.blobPath(digest), tampered, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Get(fruitPlugin + "@sha256:" + digest)
+	assert.Assert(t, errors.Is(err, ErrDigestMismatch))
+}
+
+func TestDigestRegistryGetRejectsBareName(t *testing.T) {
+	tmpdir := t.TempDir()
+	r, err := NewDigestRegistry(tmpdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Get(fruitPlugin)
+	if err == nil {
+		t.Fatal("expected Get to reject an unpinned bare name")
+	}
+}
+
+// TestDigestRegistryGetFetchesRemote asserts that Get pulls a blob that
+// isn't already in the local blobstore through r.Fetch, persists it exactly
+// as a local Pull would, and verifies it.
+func TestDigestRegistryGetFetchesRemote(t *testing.T) {
+	tmpdir := t.TempDir()
+	r, err := NewDigestRegistry(tmpdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := json.Marshal(Manifest{Implements: []string{fruitImplements}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256sum(blob)
+
+	var fetchCalls int
+	r.Fetch = func(name, d string) ([]byte, error) {
+		fetchCalls++
+		if name != fruitPlugin || d != digest {
+			t.Fatalf("unexpected fetch request: %s@sha256:%s", name, d)
+		}
+		return blob, nil
+	}
+
+	plugin, err := r.Get(fruitPlugin + "@sha256:" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin.Name() != fruitPlugin {
+		t.Fatalf("expected plugin named %s, got %s", fruitPlugin, plugin.Name())
+	}
+	if fetchCalls != 1 {
+		t.Fatalf("expected Fetch to be called once, got %d", fetchCalls)
+	}
+
+	// A second Get should find the now-local blob and not call Fetch again.
+	if _, err := r.Get(fruitPlugin + "@sha256:" + digest); err != nil {
+		t.Fatal(err)
+	}
+	if fetchCalls != 1 {
+		t.Fatalf("expected Fetch not to be called again once the blob is local, got %d calls", fetchCalls)
+	}
+}
@@ -0,0 +1,74 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// ErrExperimentalRequired is returned by Get when the requested capability
+// is listed in the plugin's Manifest.Experimental field and the daemon is
+// not running with experimental features enabled. GetAll does not return
+// it; it leaves such plugins out of its result instead.
+var ErrExperimentalRequired = errors.New("plugin: capability requires the daemon to be running with experimental features enabled")
+
+// daemonExperimental records whether the daemon was started with
+// experimental features enabled. It is read on every Get/GetAll call, so it
+// is kept as an atomic rather than guarded by the package's storage lock.
+var daemonExperimental atomic.Bool
+
+// SetExperimental is called once during daemon startup to record whether
+// experimental features are enabled, so that Get and GetAll can gate
+// plugin capabilities declared under a Manifest's Experimental field.
+func SetExperimental(experimental bool) {
+	daemonExperimental.Store(experimental)
+}
+
+// experimentalOnly reports whether every Implements entry that matches
+// implements is also listed in m.Experimental, meaning the capability is
+// only available under the experimental gate.
+func experimentalOnly(m *Manifest, implements string) bool {
+	if len(m.Experimental) == 0 {
+		return false
+	}
+	for _, exp := range m.Experimental {
+		if exp == implements {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExperimental returns ErrExperimentalRequired if implements names a
+// capability that m declares as experimental and the daemon was not
+// started with experimental features enabled. Get and GetAll call this
+// after confirming the plugin implements the requested capability at all,
+// so that a capability the plugin does not implement yields
+// ErrNotImplements rather than ErrExperimentalRequired.
+func checkExperimental(m *Manifest, implements string) error {
+	if experimentalOnly(m, implements) && !daemonExperimental.Load() {
+		return ErrExperimentalRequired
+	}
+	return nil
+}
+
+// dockerExperimentalHeader is set by a plugin's Plugin.Activate response to
+// assert that it expects to run against an experimental daemon. Activate
+// reconciles this against the manifest so that a plugin cannot silently
+// claim experimental-only capabilities as stable.
+const dockerExperimentalHeader = "Docker-Experimental"
+
+// reconcileExperimentalHeader folds the "Docker-Experimental" response
+// header from Plugin.Activate into the manifest: if the plugin asserts it
+// is experimental but did not list any capability as such, every declared
+// capability is treated as experimental.
+func reconcileExperimentalHeader(header http.Header, m *Manifest) {
+	if header.Get(dockerExperimentalHeader) != "true" {
+		return
+	}
+	if len(m.Experimental) > 0 {
+		return
+	}
+	m.Experimental = append([]string(nil), m.Implements...)
+}
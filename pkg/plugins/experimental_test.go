@@ -0,0 +1,49 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckExperimental(t *testing.T) {
+	defer SetExperimental(false)
+
+	m := &Manifest{Implements: []string{"apple", "banana"}, Experimental: []string{"banana"}}
+
+	if err := checkExperimental(m, "apple"); err != nil {
+		t.Fatalf("stable capability should not require experimental: %v", err)
+	}
+
+	err := checkExperimental(m, "banana")
+	if !errors.Is(err, ErrExperimentalRequired) {
+		t.Fatalf("expected ErrExperimentalRequired, got %v", err)
+	}
+
+	SetExperimental(true)
+	if err := checkExperimental(m, "banana"); err != nil {
+		t.Fatalf("experimental capability should be allowed once enabled: %v", err)
+	}
+}
+
+func TestReconcileExperimentalHeader(t *testing.T) {
+	m := &Manifest{Implements: []string{"apple", "banana"}}
+
+	header := http.Header{}
+	header.Set(dockerExperimentalHeader, "true")
+	reconcileExperimentalHeader(header, m)
+
+	if len(m.Experimental) != 2 {
+		t.Fatalf("expected all capabilities to be marked experimental, got %v", m.Experimental)
+	}
+}
+
+func TestReconcileExperimentalHeaderNoop(t *testing.T) {
+	m := &Manifest{Implements: []string{"apple", "banana"}}
+
+	reconcileExperimentalHeader(http.Header{}, m)
+	if m.Experimental != nil {
+		t.Fatalf("expected manifest to be untouched, got %v", m.Experimental)
+	}
+}
@@ -0,0 +1,15 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+// Manifest lists the capabilities implemented by a plugin, as returned by
+// Plugin.Activate.
+type Manifest struct {
+	// Implements is a list of capability names the plugin supports, e.g.
+	// "volumedriver" or "NetworkDriver".
+	Implements []string
+
+	// Experimental lists capability names from Implements that are only
+	// usable when the daemon is running with experimental features
+	// enabled. A plugin may mix stable and experimental capabilities in
+	// the same manifest; only the ones named here are gated.
+	Experimental []string
+}
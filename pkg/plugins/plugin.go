@@ -0,0 +1,187 @@
+package plugins // import "github.com/docker/docker/pkg/plugins"
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/docker/docker/pkg/plugins/transport"
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Get when no plugin is registered under the
+// requested name.
+var ErrNotFound = errors.New("plugin: not found")
+
+// ErrNotImplements is returned by Get when a plugin is registered but does
+// not implement the requested capability.
+var ErrNotImplements = errors.New("plugin: not implements")
+
+// Client is the low-level RPC client used by capability implementations
+// (volume and network drivers, etc.) to call a plugin's Plugin.* methods
+// once it has been activated.
+type Client struct {
+	addr string
+}
+
+// Plugin represents a legacy v1 plugin discovered either directly (tests,
+// DigestRegistry) or through a LocalRegistry spec file.
+type Plugin struct {
+	name string
+
+	Addr      string
+	TLSConfig *tlsconfig.Options
+	Manifest  *Manifest
+
+	client *Client
+
+	activateWait *sync.Cond
+	activateErr  error
+}
+
+// Name returns the name the plugin was registered under.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Client returns the plugin's RPC client. Neither activate nor the
+// registries in this package set one, so it is nil for every plugin they
+// create, including plugins activated over HTTP.
+func (p *Plugin) Client() *Client {
+	return p.client
+}
+
+// IsV1 reports whether the plugin speaks the legacy v1 protocol. Plugins
+// reachable through this package are always v1; v2 managed plugins are
+// handled by the separate plugin manager.
+func (p *Plugin) IsV1() bool {
+	return true
+}
+
+// implements reports whether the plugin's manifest lists capability.
+func (p *Plugin) implements(capability string) bool {
+	if p.Manifest == nil {
+		return false
+	}
+	for _, c := range p.Manifest.Implements {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// waitActive blocks until the plugin has a manifest (either supplied
+// directly or obtained via activate), or activation has failed.
+func (p *Plugin) waitActive() error {
+	p.activateWait.L.Lock()
+	defer p.activateWait.L.Unlock()
+	for p.Manifest == nil && p.activateErr == nil {
+		p.activateWait.Wait()
+	}
+	return p.activateErr
+}
+
+// activate calls Plugin.Activate over HTTP to obtain the plugin's
+// manifest, reconciling the "Docker-Experimental" response header into it,
+// and wakes any goroutine blocked in waitActive.
+func (p *Plugin) activate() error {
+	p.activateWait.L.Lock()
+	defer p.activateWait.L.Unlock()
+
+	if p.Manifest != nil || p.activateErr != nil {
+		return p.activateErr
+	}
+
+	m, header, err := p.requestActivate()
+	if err != nil {
+		p.activateErr = err
+		p.activateWait.Broadcast()
+		return err
+	}
+
+	reconcileExperimentalHeader(header, m)
+	p.Manifest = m
+	p.activateWait.Broadcast()
+	return nil
+}
+
+func (p *Plugin) requestActivate() (*Manifest, http.Header, error) {
+	client := &http.Client{}
+	if p.TLSConfig != nil {
+		tlsCfg, err := tlsconfig.Client(*p.TLSConfig)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "plugin %q: failed to build TLS config", p.name)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: tlsCfg}
+	}
+
+	resp, err := client.Post(p.Addr+"/Plugin.Activate", transport.VersionMimetype, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "plugin %q: failed to activate", p.name)
+	}
+	defer resp.Body.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, nil, errors.Wrapf(err, "plugin %q: invalid activate response", p.name)
+	}
+
+	return &m, resp.Header, nil
+}
+
+// storage holds every plugin this package knows about, whether registered
+// directly or discovered through a LocalRegistry.
+var storage = pluginStorage{plugins: make(map[string]*Plugin)}
+
+type pluginStorage struct {
+	sync.Mutex
+	plugins map[string]*Plugin
+}
+
+var handlers = pluginHandlers{byCapability: make(map[string][]func(string, *Client))}
+
+type pluginHandlers struct {
+	sync.Mutex
+	byCapability map[string][]func(string, *Client)
+}
+
+// Handle registers fn to be called for every plugin implementing
+// capability.
+func Handle(capability string, fn func(name string, client *Client)) {
+	handlers.Lock()
+	handlers.byCapability[capability] = append(handlers.byCapability[capability], fn)
+	handlers.Unlock()
+}
+
+// Get returns the plugin registered under name if it implements the
+// capability named by implements, activating it first if necessary.
+// It returns ErrNotFound if no such plugin is registered, ErrNotImplements
+// if it does not implement implements, and ErrExperimentalRequired if
+// implements is only available under the plugin's Experimental gate and
+// the daemon is not running with experimental features enabled.
+func Get(name, implements string) (*Plugin, error) {
+	storage.Lock()
+	p, ok := storage.plugins[name]
+	storage.Unlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "plugin %q", name)
+	}
+
+	if p.Manifest == nil {
+		if err := p.activate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.implements(implements) {
+		return nil, errors.Wrapf(ErrNotImplements, "plugin %q does not implement %q", name, implements)
+	}
+
+	if err := checkExperimental(p.Manifest, implements); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -103,7 +104,7 @@ func TestPluginWithNoManifest(t *testing.T) {
 	// TestGet also registers fruitPlugin
 	mux, addr := setupRemotePluginServer(t)
 
-	m := Manifest{[]string{fruitImplements}}
+	m := Manifest{Implements: []string{fruitImplements}}
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(m); err != nil {
 		t.Fatal(err)
@@ -175,3 +176,14 @@ func TestGetAll(t *testing.T) {
 		t.Fatalf("Expected to get plugin with name %s", plugin.Name())
 	}
 }
+
+// setupRemotePluginServer starts a TLS server for tests that exercise the
+// Plugin.Activate HTTP path, matching the InsecureSkipVerify TLSConfig
+// those tests register their Plugin with.
+func setupRemotePluginServer(t *testing.T) (*http.ServeMux, string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return mux, server.URL
+}
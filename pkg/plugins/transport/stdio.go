@@ -0,0 +1,384 @@
+package transport // import "github.com/docker/docker/pkg/plugins/transport"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/containerd/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// maxFrameSize bounds a single stdio frame so that a misbehaving or
+// compromised plugin binary cannot make the daemon allocate unbounded
+// memory decoding a length-prefixed frame.
+const maxFrameSize = 32 << 20 // 32MB
+
+// envelope wraps a Plugin.* request or response sent over a StdioTransport
+// pipe. Requests carry Method/Params, responses carry Result/Error; ID ties
+// the two together so that concurrent calls can share one pipe pair.
+type envelope struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+
+	// More is set on every response frame but the last for a streamed
+	// call (see Stream); Call never sets or expects it.
+	More bool `json:"more,omitempty"`
+}
+
+// callQueue is an unbounded, order-preserving handoff from readLoop to
+// whichever Call/Stream is waiting on a given envelope ID. readLoop
+// demultiplexes every in-flight call over one goroutine, so push must never
+// block on a slow consumer: a bounded channel would let one sluggish Stream
+// reader (e.g. listing volumes) wedge delivery for every other concurrent
+// Call sharing the transport.
+type callQueue struct {
+	in  chan envelope
+	out chan envelope
+}
+
+func newCallQueue() *callQueue {
+	q := &callQueue{in: make(chan envelope), out: make(chan envelope)}
+	go q.pump()
+	return q
+}
+
+func (q *callQueue) pump() {
+	var buf []envelope
+	for {
+		if len(buf) == 0 {
+			v, ok := <-q.in
+			if !ok {
+				close(q.out)
+				return
+			}
+			buf = append(buf, v)
+			continue
+		}
+		select {
+		case v, ok := <-q.in:
+			if !ok {
+				for _, v := range buf {
+					q.out <- v
+				}
+				close(q.out)
+				return
+			}
+			buf = append(buf, v)
+		case q.out <- buf[0]:
+			buf = buf[1:]
+		}
+	}
+}
+
+// push hands env to the queue. It never blocks on the consumer: pump is
+// always ready to buffer into memory, so push only ever waits on pump's
+// own scheduling, not on whoever eventually reads from q.out.
+func (q *callQueue) push(env envelope) {
+	q.in <- env
+}
+
+// close signals that no further envelopes will be pushed. The consumer's
+// range/receive loop observes this once it has drained any buffered
+// envelopes.
+func (q *callQueue) close() {
+	close(q.in)
+}
+
+// StdioTransport speaks the Plugin.* RPC protocol over the stdin/stdout of
+// a child process instead of over a unix or TCP socket. Frames are
+// length-prefixed (4-byte big-endian length + JSON body) and multiplexed by
+// envelope ID so that multiple Call/Stream requests can be in flight at
+// once over the single pipe pair.
+type StdioTransport struct {
+	cmdPath string
+	cmdArgs []string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	nextID  uint64
+	pending map[uint64]*callQueue
+	closed  chan struct{}
+
+	// ioDone is released once readLoop and the stderr scanner have both
+	// returned, so that reap can safely call cmd.Wait (which races with
+	// unfinished reads from the pipes it owns).
+	ioDone sync.WaitGroup
+
+	// writeMu serializes writes to stdin so that concurrent Calls can't
+	// interleave each other's length header and body on the wire.
+	writeMu sync.Mutex
+}
+
+// NewStdioTransport launches path with args as a child process and returns
+// a StdioTransport ready to make Plugin.* calls against it.
+func NewStdioTransport(path string, args ...string) (*StdioTransport, error) {
+	t := &StdioTransport{
+		cmdPath: path,
+		cmdArgs: args,
+		pending: make(map[uint64]*callQueue),
+	}
+	if err := t.start(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *StdioTransport) start() error {
+	cmd := exec.Command(t.cmdPath, t.cmdArgs...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errors.Wrap(err, "plugins/transport: failed to open stdin")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "plugins/transport: failed to open stdout")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "plugins/transport: failed to open stderr")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "plugins/transport: failed to start plugin %s", t.cmdPath)
+	}
+
+	t.mu.Lock()
+	t.cmd = cmd
+	t.stdin = stdin
+	t.closed = make(chan struct{})
+	t.mu.Unlock()
+
+	t.ioDone.Add(2)
+	go func() {
+		defer t.ioDone.Done()
+		t.readLoop(stdout)
+	}()
+	go func() {
+		defer t.ioDone.Done()
+		logStderr(t.cmdPath, stderr)
+	}()
+	go t.reap()
+
+	return nil
+}
+
+// reap waits for readLoop and the stderr scanner to finish consuming their
+// pipes and then calls cmd.Wait to collect the child's exit status. Wait
+// must not run until both pipe readers have returned: exec.Cmd documents
+// that it is incorrect to call Wait before reads from a StdoutPipe/
+// StderrPipe have completed, and skipping it entirely leaves a zombie
+// process behind every time Supervisor restarts a crashed plugin.
+func (t *StdioTransport) reap() {
+	t.ioDone.Wait()
+
+	t.mu.Lock()
+	cmd := t.cmd
+	t.mu.Unlock()
+	if cmd == nil {
+		return
+	}
+	if err := cmd.Wait(); err != nil {
+		log.G(context.Background()).WithField("plugin", t.cmdPath).WithError(err).Debug("plugin process exited")
+	}
+}
+
+// readLoop demultiplexes frames read from the child's stdout into the
+// per-call queue registered for their envelope ID. It only ever pushes to a
+// callQueue, which never blocks, so one call's queue can never stall
+// delivery to any other in-flight call on the same transport.
+func (t *StdioTransport) readLoop(r io.Reader) {
+	br := bufio.NewReader(r)
+	for {
+		env, err := readFrame(br)
+		if err != nil {
+			t.abortPending(err)
+			return
+		}
+
+		t.mu.Lock()
+		q, ok := t.pending[env.ID]
+		if ok && !env.More {
+			delete(t.pending, env.ID)
+		}
+		t.mu.Unlock()
+
+		if ok {
+			q.push(env)
+			if !env.More {
+				q.close()
+			}
+		}
+	}
+}
+
+func (t *StdioTransport) abortPending(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, q := range t.pending {
+		q.push(envelope{ID: id, Error: err.Error()})
+		q.close()
+		delete(t.pending, id)
+	}
+	close(t.closed)
+}
+
+// Call sends a Plugin.* request over stdio and blocks until the matching
+// response envelope is read back, or the transport is closed.
+func (t *StdioTransport) Call(method string, args, ret interface{}) error {
+	params, err := json.Marshal(args)
+	if err != nil {
+		return errors.Wrap(err, "plugins/transport: failed to encode params")
+	}
+
+	t.mu.Lock()
+	id := t.nextID
+	t.nextID++
+	q := newCallQueue()
+	t.pending[id] = q
+	stdin := t.stdin
+	t.mu.Unlock()
+
+	req := envelope{ID: id, Method: method, Params: params}
+
+	t.writeMu.Lock()
+	err = writeFrame(stdin, req)
+	t.writeMu.Unlock()
+
+	if err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		q.close()
+		return errors.Wrapf(err, "plugins/transport: failed to call %s", method)
+	}
+
+	resp := <-q.out
+	if resp.Error != "" {
+		return errors.Errorf("plugins/transport: %s: %s", method, resp.Error)
+	}
+	if ret == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, ret)
+}
+
+// Stream sends a Plugin.* request that produces a sequence of responses
+// rather than a single one, invoking handler with each response's Result
+// in turn. Every response but the last must have More set; Stream returns
+// once it reads one with More false, or an error frame.
+func (t *StdioTransport) Stream(method string, args interface{}, handler func(json.RawMessage) error) error {
+	params, err := json.Marshal(args)
+	if err != nil {
+		return errors.Wrap(err, "plugins/transport: failed to encode params")
+	}
+
+	t.mu.Lock()
+	id := t.nextID
+	t.nextID++
+	q := newCallQueue()
+	t.pending[id] = q
+	stdin := t.stdin
+	t.mu.Unlock()
+
+	req := envelope{ID: id, Method: method, Params: params}
+
+	t.writeMu.Lock()
+	err = writeFrame(stdin, req)
+	t.writeMu.Unlock()
+
+	if err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		q.close()
+		return errors.Wrapf(err, "plugins/transport: failed to stream %s", method)
+	}
+
+	for {
+		resp := <-q.out
+		if resp.Error != "" {
+			return errors.Errorf("plugins/transport: %s: %s", method, resp.Error)
+		}
+		if len(resp.Result) > 0 {
+			if err := handler(resp.Result); err != nil {
+				return err
+			}
+		}
+		if !resp.More {
+			return nil
+		}
+	}
+}
+
+// Close terminates the child process and unblocks any in-flight calls. The
+// process is reaped asynchronously by reap once its pipes drain; Close
+// does not block waiting for that.
+func (t *StdioTransport) Close() error {
+	t.mu.Lock()
+	cmd := t.cmd
+	t.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+func readFrame(r *bufio.Reader) (envelope, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return envelope{}, err
+	}
+	if size > maxFrameSize {
+		return envelope{}, fmt.Errorf("plugins/transport: frame of %d bytes exceeds %d byte limit", size, maxFrameSize)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return envelope{}, err
+	}
+	var env envelope
+	if err := json.Unmarshal(buf, &env); err != nil {
+		return envelope{}, err
+	}
+	return env, nil
+}
+
+// writeFrame encodes env as a single length-prefixed frame and writes it in
+// one Write call, so that callers only need to serialize calls to
+// writeFrame itself (via writeMu) to avoid interleaving header and body
+// bytes from concurrent frames on the wire.
+func writeFrame(w io.Writer, env envelope) error {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	var frame bytes.Buffer
+	if err := binary.Write(&frame, binary.BigEndian, uint32(len(body))); err != nil {
+		return err
+	}
+	frame.Write(body)
+
+	_, err = w.Write(frame.Bytes())
+	return err
+}
+
+// logStderr surfaces a child plugin's stderr as structured daemon log
+// lines, one per line written by the child, rather than letting it leak to
+// the daemon's own stderr unattributed.
+func logStderr(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.G(context.Background()).WithField("plugin", name).Debug(scanner.Text())
+	}
+}
@@ -0,0 +1,153 @@
+package transport // import "github.com/docker/docker/pkg/plugins/transport"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+)
+
+// backoffSchedule is the delay applied between restart attempts by
+// Supervisor, growing exponentially and capped at its last entry.
+var backoffSchedule = []time.Duration{
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	400 * time.Millisecond,
+	800 * time.Millisecond,
+	1600 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Activator re-activates a plugin after its StdioTransport has been
+// restarted, since activation state does not survive the child exiting.
+type Activator func(*StdioTransport) error
+
+// Supervisor keeps a StdioTransport-backed plugin alive across child
+// process exits, restarting it with exponential backoff and re-running
+// Plugin.Activate before handing a freshly restarted transport back to
+// callers.
+type Supervisor struct {
+	path string
+	args []string
+
+	activate Activator
+
+	mu        sync.Mutex
+	transport *StdioTransport
+	stopped   bool
+	stopCh    chan struct{}
+}
+
+// NewSupervisor launches path as a child process, runs activate against it,
+// and returns a Supervisor that will transparently restart the child (and
+// re-run activate) if it exits while the supervisor is running.
+func NewSupervisor(path string, args []string, activate Activator) (*Supervisor, error) {
+	s := &Supervisor{path: path, args: args, activate: activate, stopCh: make(chan struct{})}
+	t, err := s.launch()
+	if err != nil {
+		return nil, err
+	}
+	s.transport = t
+	go s.watch()
+	return s, nil
+}
+
+// Transport returns the currently live StdioTransport for the supervised
+// plugin. It changes identity across restarts, so callers should fetch it
+// again after a Call fails rather than caching it.
+func (s *Supervisor) Transport() *StdioTransport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transport
+}
+
+// Stop prevents further restarts and kills the current child process. It
+// also interrupts watch if it is currently sleeping out a restart backoff,
+// so a stop requested mid-backoff can't be missed and leave an orphaned
+// child launched after the supervisor was told to shut down.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	close(s.stopCh)
+	t := s.transport
+	s.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	return t.Close()
+}
+
+func (s *Supervisor) watch() {
+	for attempt := 0; ; attempt++ {
+		t := s.Transport()
+		if t == nil {
+			return
+		}
+		<-t.closed
+
+		if s.isStopped() {
+			return
+		}
+
+		idx := attempt
+		if idx >= len(backoffSchedule) {
+			idx = len(backoffSchedule) - 1
+		}
+		delay := backoffSchedule[idx]
+		log.G(context.Background()).WithField("plugin", s.path).Warnf("plugin exited, restarting in %s", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-s.stopCh:
+			return
+		}
+
+		// Stop may have raced with the backoff above and still land here
+		// right after time.After wins the select; re-check before paying
+		// for a launch that would only be thrown away.
+		if s.isStopped() {
+			return
+		}
+
+		next, err := s.launch()
+		if err != nil {
+			log.G(context.Background()).WithField("plugin", s.path).WithError(err).Error("failed to restart plugin")
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			next.Close()
+			return
+		}
+		s.transport = next
+		s.mu.Unlock()
+		attempt = -1 // reset backoff after a successful restart+activate
+	}
+}
+
+func (s *Supervisor) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *Supervisor) launch() (*StdioTransport, error) {
+	t, err := NewStdioTransport(s.path, s.args...)
+	if err != nil {
+		return nil, err
+	}
+	if s.activate != nil {
+		if err := s.activate(t); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
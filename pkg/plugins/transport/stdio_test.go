@@ -0,0 +1,167 @@
+package transport // import "github.com/docker/docker/pkg/plugins/transport"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	want := envelope{ID: 7, Method: "Plugin.Activate", Params: json.RawMessage(`{"foo":"bar"}`)}
+	if err := writeFrame(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != want.ID || got.Method != want.Method || string(got.Params) != string(want.Params) {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, want)
+	}
+}
+
+func TestFrameRejectsOversized(t *testing.T) {
+	var buf bytes.Buffer
+	// A length prefix larger than maxFrameSize must be rejected before any
+	// attempt to allocate or read the body.
+	if err := writeFrame(&buf, envelope{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	raw[0], raw[1], raw[2], raw[3] = 0xff, 0xff, 0xff, 0xff
+
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(raw))); err == nil {
+		t.Fatal("expected oversized frame to be rejected")
+	}
+}
+
+// TestConcurrentWriteFrameDoesNotInterleave asserts that serializing
+// writeFrame calls with a shared mutex (as StdioTransport.Call does via
+// writeMu) is sufficient to keep concurrent frames from interleaving their
+// length header and body on the wire: every frame decodes back intact and
+// in one piece.
+func TestConcurrentWriteFrameDoesNotInterleave(t *testing.T) {
+	const n = 50
+
+	var buf bytes.Buffer
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := envelope{ID: uint64(i), Method: "Plugin.Activate", Params: json.RawMessage(fmt.Sprintf(`{"i":%d}`, i))}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := writeFrame(&buf, env); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool, n)
+	br := bufio.NewReader(&buf)
+	for i := 0; i < n; i++ {
+		env, err := readFrame(br)
+		if err != nil {
+			t.Fatalf("frame %d: %v (interleaved writes corrupted the stream)", i, err)
+		}
+		if seen[env.ID] {
+			t.Fatalf("frame %d: duplicate ID %d, stream is corrupted", i, env.ID)
+		}
+		seen[env.ID] = true
+	}
+}
+
+type failingStdin struct{}
+
+func (failingStdin) Write([]byte) (int, error) { return 0, fmt.Errorf("boom") }
+func (failingStdin) Close() error              { return nil }
+
+func TestCallCleansUpPendingOnWriteFailure(t *testing.T) {
+	tr := &StdioTransport{
+		pending: make(map[uint64]*callQueue),
+		stdin:   failingStdin{},
+	}
+
+	if err := tr.Call("Plugin.Activate", nil, nil); err == nil {
+		t.Fatal("expected Call to fail when the write fails")
+	}
+
+	if len(tr.pending) != 0 {
+		t.Fatalf("expected no leaked pending entries after a write failure, got %d", len(tr.pending))
+	}
+}
+
+// recordingStdin keeps every frame written to it and then fails the write,
+// so that Call returns instead of waiting for a response.
+type recordingStdin struct{ bytes.Buffer }
+
+func (r *recordingStdin) Write(p []byte) (int, error) {
+	r.Buffer.Write(p)
+	return 0, fmt.Errorf("boom")
+}
+func (r *recordingStdin) Close() error { return nil }
+
+func TestMultiplexedCallsGetDistinctIDs(t *testing.T) {
+	stdin := &recordingStdin{}
+	tr := &StdioTransport{pending: make(map[uint64]*callQueue), stdin: stdin}
+
+	_ = tr.Call("Plugin.Activate", nil, nil)
+	_ = tr.Call("Plugin.Activate", nil, nil)
+
+	br := bufio.NewReader(&stdin.Buffer)
+	first, err := readFrame(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := readFrame(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.ID == second.ID {
+		t.Fatalf("expected distinct call IDs, got %d and %d", first.ID, second.ID)
+	}
+}
+
+// TestCallQueueDoesNotBlockOnSlowConsumer asserts that pushing to a
+// callQueue never blocks the pusher (readLoop), even when nothing is
+// reading from q.out yet: a slow Stream consumer must not be able to wedge
+// demuxing for every other concurrent call on the transport.
+func TestCallQueueDoesNotBlockOnSlowConsumer(t *testing.T) {
+	q := newCallQueue()
+	defer q.close()
+
+	const n = 100
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			q.push(envelope{ID: uint64(i), More: true})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push blocked waiting for a consumer; callQueue must be unbounded")
+	}
+
+	for i := 0; i < n; i++ {
+		env := <-q.out
+		if env.ID != uint64(i) {
+			t.Fatalf("envelope %d: got out of order ID %d", i, env.ID)
+		}
+	}
+}
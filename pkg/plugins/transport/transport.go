@@ -0,0 +1,6 @@
+package transport // import "github.com/docker/docker/pkg/plugins/transport"
+
+// VersionMimetype names the version of the v1 plugin protocol. It is sent
+// as the Content-Type of Plugin.Activate requests; the Content-Type of the
+// response is not checked.
+const VersionMimetype = "application/vnd.docker.plugins.v1.1+json"